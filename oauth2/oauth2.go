@@ -0,0 +1,233 @@
+// Package oauth2 layers OAuth 2.0 / social-login flows on top of the
+// sessionauth Account model. It persists the provider token in the
+// session.Store, resolves a local Account from the remote profile via a
+// caller-supplied function, and then hands off to sessionauth.AuthenticateSession
+// exactly like a normal password login would.
+package oauth2
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/codinl/go-logger"
+	"github.com/codinl/session"
+	"github.com/codinl/sessionauth"
+	"github.com/go-martini/martini"
+	"github.com/martini-contrib/render"
+	"golang.org/x/oauth2"
+)
+
+// These are the default configuration values for this package. They can be
+// overridden at anytime, probably during the initial setup of Martini.
+var (
+	// LoginPath is the route that starts the OAuth2 dance by redirecting to
+	// the provider's consent screen.
+	LoginPath string = "/login"
+
+	// LogoutPath is the route that clears the stored token.
+	LogoutPath string = "/logout"
+
+	// CallbackPath is the route the provider redirects back to after the
+	// user grants (or denies) access.
+	CallbackPath string = "/oauth2callback"
+
+	// ErrorPath is where a failed callback redirects to.
+	ErrorPath string = "/oauth2error"
+)
+
+// sessionKeyPrefix namespaces the stored token so it doesn't collide with
+// sessionauth.AUTH_UNIQUE_ID or other session data.
+const sessionKeyPrefix string = "OAUTH2_TOKEN_"
+
+// stateKeyPrefix and nextKeyPrefix namespace the per-provider CSRF state and
+// the "next" URL across the redirect to the provider and back.
+const stateKeyPrefix string = "OAUTH2_STATE_"
+const nextKeyPrefix string = "OAUTH2_NEXT_"
+
+// Profile is the subset of the remote account that providers are expected
+// to be able to fetch after exchanging a token.
+type Profile struct {
+	Id    string
+	Email string
+	Login string
+}
+
+// Tokens wraps the provider token together with the profile that was
+// fetched with it and the name of the provider that produced it.
+type Tokens struct {
+	*oauth2.Token
+	Profile  Profile
+	Provider string
+}
+
+// Resolver maps a set of Tokens to a local Account, creating one if
+// necessary. It is called once per successful callback, before
+// sessionauth.AuthenticateSession is invoked.
+type Resolver func(tokens Tokens) (sessionauth.Account, error)
+
+// Provider is implemented by each social-login backend this package
+// supports. Config returns the oauth2.Config to use for the authorization
+// code flow; Profile fetches the remote user's profile once a token has
+// been obtained.
+type Provider interface {
+	Name() string
+	Config() *oauth2.Config
+	Profile(token *oauth2.Token) (Profile, error)
+}
+
+// randomToken returns a random, hex-encoded, byte-length-n token, used here
+// as the OAuth2 CSRF state.
+func randomToken(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+func sessionKey(provider string) string {
+	return sessionKeyPrefix + provider
+}
+
+func stateSessionKey(provider string) string {
+	return stateKeyPrefix + provider
+}
+
+func nextSessionKey(provider string) string {
+	return nextKeyPrefix + provider
+}
+
+// sanitizeNext rejects anything that isn't a local path (one leading "/",
+// no scheme or host), so
+// a forged or attacker-supplied "next" can't be used to bounce a visitor off
+// to an external site (an open redirect) once login succeeds. Backslashes
+// are rejected outright: browsers normalize "\" to "/", so "/\evil.com"
+// would otherwise slip through as a protocol-relative "//evil.com".
+func sanitizeNext(next string) string {
+	if next == "" || !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") {
+		return "/"
+	}
+	if strings.ContainsAny(next, "\\") {
+		return "/"
+	}
+	if u, err := url.Parse(next); err != nil || u.Scheme != "" || u.Host != "" {
+		return "/"
+	}
+	return next
+}
+
+// startOAuth redirects w/r to provider's consent screen, stamping the
+// session with a random CSRF state and the sanitized next URL so
+// CallbackHandler can verify the state and send the visitor on afterwards.
+func startOAuth(w http.ResponseWriter, r *http.Request, s session.Store, provider Provider, next string) {
+	state, err := randomToken(16)
+	if err != nil {
+		logger.Error(err)
+		http.Redirect(w, r, ErrorPath, 302)
+		return
+	}
+
+	s.Set(stateSessionKey(provider.Name()), state)
+	s.Set(nextSessionKey(provider.Name()), sanitizeNext(next))
+
+	http.Redirect(w, r, provider.Config().AuthCodeURL(state), 302)
+}
+
+// LoginHandler redirects the visitor to the provider's consent screen. The
+// "next" query parameter, if present, is stashed in the session (not the
+// OAuth2 state, which carries only a random CSRF nonce) so CallbackHandler
+// can send the visitor on afterwards.
+func LoginHandler(provider Provider) martini.Handler {
+	return func(w http.ResponseWriter, r *http.Request, s session.Store) {
+		next := r.URL.Query().Get(sessionauth.RedirectParam)
+		startOAuth(w, r, s, provider, next)
+	}
+}
+
+// CallbackHandler exchanges the authorization code for a token, fetches the
+// remote profile, resolves it to a local Account via resolve, persists the
+// token in the session and authenticates it.
+func CallbackHandler(provider Provider, resolve Resolver) martini.Handler {
+	return func(w http.ResponseWriter, r *http.Request, s session.Store, render render.Render) {
+		if errMsg := r.URL.Query().Get("error"); errMsg != "" {
+			logger.Error("oauth2 callback error=", errMsg)
+			render.Redirect(ErrorPath, 302)
+			return
+		}
+
+		stateKey := stateSessionKey(provider.Name())
+		expectedState, _ := s.Get(stateKey).(string)
+		s.Delete(stateKey)
+
+		if expectedState == "" || r.URL.Query().Get("state") != expectedState {
+			logger.Error("oauth2 callback state mismatch, possible CSRF")
+			render.Redirect(ErrorPath, 302)
+			return
+		}
+
+		nextKey := nextSessionKey(provider.Name())
+		next, _ := s.Get(nextKey).(string)
+		s.Delete(nextKey)
+		next = sanitizeNext(next)
+
+		code := r.URL.Query().Get("code")
+		token, err := provider.Config().Exchange(r.Context(), code)
+		if err != nil {
+			logger.Error(err)
+			render.Redirect(ErrorPath, 302)
+			return
+		}
+
+		profile, err := provider.Profile(token)
+		if err != nil {
+			logger.Error(err)
+			render.Redirect(ErrorPath, 302)
+			return
+		}
+
+		tokens := Tokens{Token: token, Profile: profile, Provider: provider.Name()}
+		account, err := resolve(tokens)
+		if err != nil {
+			logger.Error(err)
+			render.Redirect(ErrorPath, 302)
+			return
+		}
+
+		s.Set(sessionKey(provider.Name()), token)
+		if err := sessionauth.AuthenticateSession(s, account, r); err != nil {
+			logger.Error(err)
+			render.Redirect(ErrorPath, 302)
+			return
+		}
+
+		render.Redirect(next, 302)
+	}
+}
+
+// LogoutHandler clears the stored provider token and the sessionauth
+// session, then redirects to next. The Account is the one Martini mapped
+// for this request (via sessionauth.SessionAccount), not a value captured
+// at route-registration time.
+func LogoutHandler(provider Provider, next string) martini.Handler {
+	return func(s session.Store, w http.ResponseWriter, r *http.Request, account sessionauth.Account, render render.Render) {
+		s.Delete(sessionKey(provider.Name()))
+		sessionauth.Logout(s, account, w, r)
+		render.Redirect(next, 302)
+	}
+}
+
+// LoginRequiredOAuth mirrors sessionauth.LoginRequired, but instead of
+// sending an unauthenticated visitor to a local login form it sends them
+// through the given provider's OAuth2 consent screen, preserving the
+// "next" parameter so CallbackHandler can return them to where they
+// started.
+func LoginRequiredOAuth(provider Provider) martini.Handler {
+	return func(w http.ResponseWriter, r *http.Request, s session.Store, account sessionauth.Account) {
+		if account.IsAuthenticated() == false {
+			startOAuth(w, r, s, provider, r.URL.Path)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package sessionauth
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/go-martini/martini"
+	"github.com/martini-contrib/render"
+)
+
+// RoleAccount is an optional extension of Account. Callers whose Account
+// implementation wants to use RequireRole, RequirePermission or
+// AssignmentHandler should implement it; it is asserted at runtime so
+// existing Account implementations keep compiling unchanged.
+type RoleAccount interface {
+	Account
+
+	// Roles returns the set of roles assigned to this account.
+	Roles() []string
+
+	// HasPermission reports whether this account has been granted the
+	// named permission, either directly or through one of its roles.
+	HasPermission(permission string) bool
+}
+
+// ForbiddenHandler is called instead of a login redirect when a visitor is
+// authenticated but not authorized. The default renders a plain 403.
+var ForbiddenHandler = func(r render.Render) {
+	r.Text(403, "Forbidden")
+}
+
+// hasRole reports whether account has at least one of roles.
+func hasRole(account RoleAccount, roles []string) bool {
+	granted := account.Roles()
+	for _, want := range roles {
+		for _, have := range granted {
+			if want == have {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// RequireRole builds a martini.Handler that allows the request through only
+// if the current Account is authenticated, implements RoleAccount and has
+// at least one of the given roles. Unauthenticated visitors are redirected
+// to RedirectUrl like LoginRequired; authenticated-but-unauthorized
+// visitors are handed to ForbiddenHandler.
+func RequireRole(roles ...string) martini.Handler {
+	return func(r render.Render, account Account, req *http.Request, c martini.Context) {
+		if account.IsAuthenticated() == false {
+			path := fmt.Sprintf("%s?%s=%s", RedirectUrl, RedirectParam, req.URL.Path)
+			r.Redirect(path, 302)
+			return
+		}
+
+		roleAccount, ok := account.(RoleAccount)
+		if !ok || !hasRole(roleAccount, roles) {
+			c.Invoke(ForbiddenHandler)
+			return
+		}
+	}
+}
+
+// RequirePermission builds a martini.Handler analogous to RequireRole, but
+// checks RoleAccount.HasPermission instead of Roles. The account is allowed
+// through if it holds at least one of the given permissions.
+func RequirePermission(perms ...string) martini.Handler {
+	return func(r render.Render, account Account, req *http.Request, c martini.Context) {
+		if account.IsAuthenticated() == false {
+			path := fmt.Sprintf("%s?%s=%s", RedirectUrl, RedirectParam, req.URL.Path)
+			r.Redirect(path, 302)
+			return
+		}
+
+		roleAccount, ok := account.(RoleAccount)
+		if !ok {
+			c.Invoke(ForbiddenHandler)
+			return
+		}
+
+		for _, perm := range perms {
+			if roleAccount.HasPermission(perm) {
+				return
+			}
+		}
+		c.Invoke(ForbiddenHandler)
+	}
+}
+
+// RequireFunc builds a martini.Handler that allows the request through only
+// if authorize returns true for the current Account. It is the escape
+// hatch for authorization rules that don't fit RequireRole or
+// RequirePermission.
+func RequireFunc(authorize func(Account) bool) martini.Handler {
+	return func(r render.Render, account Account, req *http.Request, c martini.Context) {
+		if account.IsAuthenticated() == false {
+			path := fmt.Sprintf("%s?%s=%s", RedirectUrl, RedirectParam, req.URL.Path)
+			r.Redirect(path, 302)
+			return
+		}
+
+		if !authorize(account) {
+			c.Invoke(ForbiddenHandler)
+			return
+		}
+	}
+}
+
+// Resource is any domain object that AssignmentHandler can load by route
+// param and check an Account's access against.
+type Resource interface {
+	// UniqueId returns the identifier used to look this resource up, as
+	// parsed from the route param AssignmentHandler was given.
+	UniqueId() interface{}
+}
+
+// AssignmentHandler builds a martini.Handler that loads a Resource by the
+// named route param (via load), checks the current Account's access
+// against it (via permission), and maps both the resource and the
+// resulting permission set into the Martini context for downstream
+// handlers to use. It mirrors the RepoAssignment pattern of per-resource
+// authorization middleware: unlike RequireRole/RequirePermission, which
+// gate a whole route on a static role or permission, AssignmentHandler
+// computes the permission set for this specific resource instance.
+func AssignmentHandler(param string, load func(id string) (Resource, error), permission func(Account, Resource) []string) martini.Handler {
+	return func(params martini.Params, account Account, c martini.Context) {
+		resource, err := load(params[param])
+		if err != nil {
+			c.Invoke(ForbiddenHandler)
+			return
+		}
+
+		perms := permission(account, resource)
+		c.Map(resource)
+		c.Map(perms)
+	}
+}
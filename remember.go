@@ -0,0 +1,232 @@
+package sessionauth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/codinl/go-logger"
+	"github.com/codinl/session"
+)
+
+// RememberCookieName is the cookie that carries the remember-me selector
+// and validator. It can be changed at anytime, probably during the
+// initial setup of Martini.
+var RememberCookieName string = "remember_me"
+
+// RememberTTL is how long a remember-me cookie, and the token behind it,
+// stays valid each time it is rotated on use. The first issue uses the ttl
+// passed to AuthenticateSessionRemember instead.
+var RememberTTL time.Duration = 30 * 24 * time.Hour
+
+// RememberToken is a single persisted remember-me credential. ValidatorHash
+// is the SHA-256 hash of the validator that was handed to the browser;
+// only the hash is ever stored, so a leaked database can't be replayed.
+type RememberToken struct {
+	Selector      string
+	ValidatorHash string
+	AccountId     interface{}
+	ExpiresAt     time.Time
+}
+
+// RememberTokenStore persists RememberTokens. Callers implement it backed
+// by whatever database they already use for Account.
+type RememberTokenStore interface {
+	// Save persists token, replacing any existing token with the same
+	// Selector.
+	Save(token RememberToken) error
+
+	// FindBySelector returns the token previously saved under selector,
+	// or an error if none exists.
+	FindBySelector(selector string) (RememberToken, error)
+
+	// DeleteBySelector removes the token saved under selector, if any.
+	DeleteBySelector(selector string) error
+
+	// DeleteByAccountId removes every token belonging to accountId.
+	DeleteByAccountId(accountId interface{}) error
+}
+
+// RememberTokens is the RememberTokenStore that AuthenticateSessionRemember,
+// SessionAccount and Logout operate on. It must be set before any of those
+// are called with remember-me enabled.
+var RememberTokens RememberTokenStore
+
+var ErrNoRememberToken = errors.New("sessionauth: no remember-me cookie present")
+
+// randomToken returns a random, hex-encoded, byte-length-n token.
+func randomToken(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+func hashValidator(validator string) string {
+	sum := sha256.Sum256([]byte(validator))
+	return hex.EncodeToString(sum[:])
+}
+
+func encodeRememberCookie(selector, validator string) string {
+	return base64.URLEncoding.EncodeToString([]byte(selector + ":" + validator))
+}
+
+func decodeRememberCookie(value string) (selector, validator string, err error) {
+	raw, err := base64.URLEncoding.DecodeString(value)
+	if err != nil {
+		return "", "", err
+	}
+	parts := strings.SplitN(string(raw), ":", 2)
+	if len(parts) != 2 {
+		return "", "", errors.New("sessionauth: malformed remember-me cookie")
+	}
+	return parts[0], parts[1], nil
+}
+
+func setRememberCookie(w http.ResponseWriter, selector, validator string, ttl time.Duration) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     RememberCookieName,
+		Value:    encodeRememberCookie(selector, validator),
+		Path:     "/",
+		Expires:  time.Now().Add(ttl),
+		HttpOnly: true,
+		Secure:   true,
+	})
+}
+
+func clearRememberCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     RememberCookieName,
+		Value:    "",
+		Path:     "/",
+		Expires:  time.Unix(0, 0),
+		HttpOnly: true,
+		Secure:   true,
+		MaxAge:   -1,
+	})
+}
+
+// AuthenticateSessionRemember behaves like AuthenticateSession, and in
+// addition issues a remember-me cookie good for ttl. The cookie holds the
+// selector and validator base64-encoded; it is not signed. The selector
+// and a hash of the validator are persisted via RememberTokens so that a
+// later request with no session can be silently reauthenticated by
+// resolveRememberCookie.
+//
+// It takes req *http.Request, beyond the (store, writer, account, ttl) a
+// bare remember-me helper might otherwise need, because it calls
+// AuthenticateSession, which requires req to stamp the session fingerprint.
+func AuthenticateSessionRemember(s session.Store, w http.ResponseWriter, req *http.Request, account Account, ttl time.Duration) error {
+	if RememberTokens == nil {
+		return errors.New("sessionauth: RememberTokens store is not configured")
+	}
+
+	if err := AuthenticateSession(s, account, req); err != nil {
+		return err
+	}
+
+	selector, err := randomToken(16)
+	if err != nil {
+		return err
+	}
+	validator, err := randomToken(32)
+	if err != nil {
+		return err
+	}
+
+	token := RememberToken{
+		Selector:      selector,
+		ValidatorHash: hashValidator(validator),
+		AccountId:     account.UniqueId(),
+		ExpiresAt:     time.Now().Add(ttl),
+	}
+	if err := RememberTokens.Save(token); err != nil {
+		return err
+	}
+
+	setRememberCookie(w, selector, validator, ttl)
+	return nil
+}
+
+// resolveRememberCookie looks for a remember-me cookie on req, verifies it
+// against RememberTokens in constant time, rotates the validator on
+// success, and returns the account ID it authenticates. Any failure -
+// missing cookie, unknown selector, expired or mismatched validator -
+// returns an error and leaves no trace of a successful attempt.
+func resolveRememberCookie(w http.ResponseWriter, req *http.Request, ttl time.Duration) (interface{}, error) {
+	cookie, err := req.Cookie(RememberCookieName)
+	if err != nil {
+		return nil, ErrNoRememberToken
+	}
+
+	selector, validator, err := decodeRememberCookie(cookie.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := RememberTokens.FindBySelector(selector)
+	if err != nil {
+		return nil, err
+	}
+
+	if time.Now().After(token.ExpiresAt) {
+		RememberTokens.DeleteBySelector(selector)
+		return nil, errors.New("sessionauth: remember-me token expired")
+	}
+
+	if subtle.ConstantTimeCompare([]byte(hashValidator(validator)), []byte(token.ValidatorHash)) != 1 {
+		// The validator didn't match a live selector: treat this as a
+		// possible theft of the cookie and burn the token.
+		RememberTokens.DeleteBySelector(selector)
+		return nil, errors.New("sessionauth: remember-me validator mismatch")
+	}
+
+	newValidator, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	token.ValidatorHash = hashValidator(newValidator)
+	token.ExpiresAt = time.Now().Add(ttl)
+	if err := RememberTokens.Save(token); err != nil {
+		return nil, err
+	}
+	setRememberCookie(w, selector, newValidator, ttl)
+
+	return token.AccountId, nil
+}
+
+// LogoutAllDevices purges every remember-me token belonging to account,
+// signing it out of every browser it's currently remembered on.
+func LogoutAllDevices(account Account) error {
+	if RememberTokens == nil {
+		return nil
+	}
+	return RememberTokens.DeleteByAccountId(account.UniqueId())
+}
+
+func deleteRememberCookie(w http.ResponseWriter, req *http.Request) {
+	if RememberTokens == nil {
+		return
+	}
+
+	cookie, err := req.Cookie(RememberCookieName)
+	if err != nil {
+		return
+	}
+
+	selector, _, err := decodeRememberCookie(cookie.Value)
+	if err == nil {
+		if err := RememberTokens.DeleteBySelector(selector); err != nil {
+			logger.Error(err)
+		}
+	}
+
+	clearRememberCookie(w)
+}
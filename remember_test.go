@@ -0,0 +1,152 @@
+package sessionauth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// fakeRememberStore is an in-memory RememberTokenStore for tests.
+type fakeRememberStore struct {
+	bySelector map[string]RememberToken
+}
+
+func newFakeRememberStore() *fakeRememberStore {
+	return &fakeRememberStore{bySelector: make(map[string]RememberToken)}
+}
+
+func (f *fakeRememberStore) Save(token RememberToken) error {
+	f.bySelector[token.Selector] = token
+	return nil
+}
+
+func (f *fakeRememberStore) FindBySelector(selector string) (RememberToken, error) {
+	token, ok := f.bySelector[selector]
+	if !ok {
+		return RememberToken{}, ErrNoRememberToken
+	}
+	return token, nil
+}
+
+func (f *fakeRememberStore) DeleteBySelector(selector string) error {
+	delete(f.bySelector, selector)
+	return nil
+}
+
+func (f *fakeRememberStore) DeleteByAccountId(accountId interface{}) error {
+	for sel, tok := range f.bySelector {
+		if tok.AccountId == accountId {
+			delete(f.bySelector, sel)
+		}
+	}
+	return nil
+}
+
+func withRememberCookie(req *http.Request, selector, validator string) *http.Request {
+	req.AddCookie(&http.Cookie{
+		Name:  RememberCookieName,
+		Value: encodeRememberCookie(selector, validator),
+	})
+	return req
+}
+
+func TestResolveRememberCookie(t *testing.T) {
+	old := RememberTokens
+	defer func() { RememberTokens = old }()
+
+	t.Run("no cookie returns ErrNoRememberToken", func(t *testing.T) {
+		RememberTokens = newFakeRememberStore()
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/", nil)
+
+		if _, err := resolveRememberCookie(w, req, time.Hour); err != ErrNoRememberToken {
+			t.Fatalf("err = %v, want ErrNoRememberToken", err)
+		}
+	})
+
+	t.Run("valid cookie authenticates and rotates the validator", func(t *testing.T) {
+		store := newFakeRememberStore()
+		RememberTokens = store
+
+		selector := "selector1"
+		validator := "validator1"
+		accountId := "account-42"
+		store.bySelector[selector] = RememberToken{
+			Selector:      selector,
+			ValidatorHash: hashValidator(validator),
+			AccountId:     accountId,
+			ExpiresAt:     time.Now().Add(time.Hour),
+		}
+
+		w := httptest.NewRecorder()
+		req := withRememberCookie(httptest.NewRequest("GET", "/", nil), selector, validator)
+
+		gotId, err := resolveRememberCookie(w, req, time.Hour)
+		if err != nil {
+			t.Fatalf("resolveRememberCookie: %v", err)
+		}
+		if gotId != accountId {
+			t.Errorf("accountId = %v, want %v", gotId, accountId)
+		}
+
+		rotated, ok := store.bySelector[selector]
+		if !ok {
+			t.Fatal("token was deleted instead of rotated")
+		}
+		if rotated.ValidatorHash == hashValidator(validator) {
+			t.Error("validator was not rotated")
+		}
+		if len(w.Result().Cookies()) == 0 {
+			t.Error("no cookie was set for the rotated validator")
+		}
+	})
+
+	t.Run("validator mismatch burns the token", func(t *testing.T) {
+		store := newFakeRememberStore()
+		RememberTokens = store
+
+		selector := "selector2"
+		store.bySelector[selector] = RememberToken{
+			Selector:      selector,
+			ValidatorHash: hashValidator("real-validator"),
+			AccountId:     "account-1",
+			ExpiresAt:     time.Now().Add(time.Hour),
+		}
+
+		w := httptest.NewRecorder()
+		req := withRememberCookie(httptest.NewRequest("GET", "/", nil), selector, "wrong-validator")
+
+		if _, err := resolveRememberCookie(w, req, time.Hour); err == nil {
+			t.Fatal("expected an error for a mismatched validator")
+		}
+
+		if _, ok := store.bySelector[selector]; ok {
+			t.Error("token was not burned after a validator mismatch")
+		}
+	})
+
+	t.Run("expired token is rejected and burned", func(t *testing.T) {
+		store := newFakeRememberStore()
+		RememberTokens = store
+
+		selector := "selector3"
+		validator := "validator3"
+		store.bySelector[selector] = RememberToken{
+			Selector:      selector,
+			ValidatorHash: hashValidator(validator),
+			AccountId:     "account-1",
+			ExpiresAt:     time.Now().Add(-time.Minute),
+		}
+
+		w := httptest.NewRecorder()
+		req := withRememberCookie(httptest.NewRequest("GET", "/", nil), selector, validator)
+
+		if _, err := resolveRememberCookie(w, req, time.Hour); err == nil {
+			t.Fatal("expected an error for an expired token")
+		}
+		if _, ok := store.bySelector[selector]; ok {
+			t.Error("expired token was not deleted")
+		}
+	})
+}
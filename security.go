@@ -0,0 +1,164 @@
+package sessionauth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/codinl/session"
+)
+
+// These session keys hold the session-security bookkeeping that
+// AuthenticateSession, SessionAccount and Logout maintain alongside
+// AUTH_UNIQUE_ID.
+const (
+	AUTH_NONCE       string = "AUTH_NONCE"
+	AUTH_FINGERPRINT string = "AUTH_FINGERPRINT"
+	AUTH_LAST_SEEN   string = "AUTH_LAST_SEEN"
+	AUTH_LOGIN_AT    string = "AUTH_LOGIN_AT"
+)
+
+// BindMode controls how much of the client's address is folded into the
+// session fingerprint.
+type BindMode int
+
+const (
+	// BindNone ignores the client IP entirely.
+	BindNone BindMode = iota
+
+	// BindSubnet folds in the IP's /24 (IPv4) or /64 (IPv6) network, which
+	// tolerates the address changes mobile carriers make mid-session.
+	BindSubnet
+
+	// BindStrict folds in the full client IP. Most secure, but will log out
+	// mobile clients whose carrier rotates their address mid-session.
+	BindStrict
+)
+
+// SessionRotator is implemented by session.Store implementations that can
+// issue a fresh session ID without losing the data already stored in it.
+// AuthenticateSession uses it, when available, to rotate the session ID on
+// login and defeat session fixation.
+type SessionRotator interface {
+	Regenerate() error
+}
+
+// SecurityOptions configures the session-fingerprint and timeout behavior
+// applied by AuthenticateSession, SessionAccount and Logout. The zero value
+// disables all of it, preserving this package's previous behavior.
+type SecurityOptions struct {
+	// BindIP controls how much of the client's IP address is folded into
+	// the session fingerprint.
+	BindIP BindMode
+
+	// BindUserAgent folds the request's User-Agent header into the
+	// fingerprint.
+	BindUserAgent bool
+
+	// IdleTimeout, if non-zero, logs a session out once this long has
+	// elapsed since AUTH_LAST_SEEN was last updated.
+	IdleTimeout time.Duration
+
+	// AbsoluteTimeout, if non-zero, logs a session out once this long has
+	// elapsed since AUTH_LOGIN_AT, regardless of activity.
+	AbsoluteTimeout time.Duration
+}
+
+// Security holds the SecurityOptions applied by this package. It can be set
+// at anytime, probably during the initial setup of Martini.
+var Security = SecurityOptions{}
+
+// clientIP extracts the client IP from req, stripping the port if present.
+func clientIP(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
+
+// normalizeIP reduces ip down to the network fragment mode calls for.
+func normalizeIP(ip string, mode BindMode) string {
+	if mode == BindNone {
+		return ""
+	}
+
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ip
+	}
+
+	if mode == BindStrict {
+		return parsed.String()
+	}
+
+	if v4 := parsed.To4(); v4 != nil {
+		return net.IPv4(v4[0], v4[1], v4[2], 0).String()
+	}
+	return parsed.Mask(net.CIDRMask(64, 128)).String()
+}
+
+// fingerprint derives the session fingerprint from the parts of req that
+// opts says should be bound, plus the per-session nonce.
+func fingerprint(req *http.Request, nonce string, opts SecurityOptions) string {
+	parts := []string{nonce}
+	if opts.BindUserAgent {
+		parts = append(parts, req.UserAgent())
+	}
+	if opts.BindIP != BindNone {
+		parts = append(parts, normalizeIP(clientIP(req), opts.BindIP))
+	}
+
+	sum := sha256.Sum256([]byte(strings.Join(parts, "|")))
+	return hex.EncodeToString(sum[:])
+}
+
+// randomNonce returns a random hex-encoded value suitable for use as
+// AUTH_NONCE.
+func randomNonce() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// sessionValid reports whether the session's stored fingerprint matches
+// req under the configured Security options, and that neither the idle nor
+// the absolute timeout has been exceeded.
+func sessionValid(s session.Store, req *http.Request) bool {
+	expected, _ := s.Get(AUTH_FINGERPRINT).(string)
+	if expected != "" {
+		nonce, _ := s.Get(AUTH_NONCE).(string)
+		if fingerprint(req, nonce, Security) != expected {
+			return false
+		}
+	}
+
+	now := time.Now()
+	if Security.IdleTimeout > 0 {
+		if lastSeen, ok := s.Get(AUTH_LAST_SEEN).(time.Time); ok && now.Sub(lastSeen) > Security.IdleTimeout {
+			return false
+		}
+	}
+	if Security.AbsoluteTimeout > 0 {
+		if loginAt, ok := s.Get(AUTH_LOGIN_AT).(time.Time); ok && now.Sub(loginAt) > Security.AbsoluteTimeout {
+			return false
+		}
+	}
+
+	return true
+}
+
+// clearAuthKeys removes every session key this package writes.
+func clearAuthKeys(s session.Store) {
+	s.Delete(AUTH_UNIQUE_ID)
+	s.Delete(AUTH_NONCE)
+	s.Delete(AUTH_FINGERPRINT)
+	s.Delete(AUTH_LAST_SEEN)
+	s.Delete(AUTH_LOGIN_AT)
+}
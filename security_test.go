@@ -0,0 +1,168 @@
+package sessionauth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// fakeStore is a minimal, in-memory session.Store used by the
+// session-security tests. Get, Set, Delete and Clear work on a map; the
+// flash, options and ID methods are stubs this package never calls.
+type fakeStore struct {
+	data map[interface{}]interface{}
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{data: make(map[interface{}]interface{})}
+}
+
+func (f *fakeStore) Get(key interface{}) interface{} {
+	return f.data[key]
+}
+
+func (f *fakeStore) Set(key interface{}, val interface{}) {
+	f.data[key] = val
+}
+
+func (f *fakeStore) Delete(key interface{}) {
+	delete(f.data, key)
+}
+
+func (f *fakeStore) Clear() {
+	f.data = make(map[interface{}]interface{})
+}
+
+func (f *fakeStore) AddFlash(value interface{}, vars ...string) {}
+
+func (f *fakeStore) Flashes(vars ...string) []interface{} { return nil }
+
+func (f *fakeStore) Options(interface{}) {}
+
+func (f *fakeStore) ID() string { return "fake" }
+
+func newRequest(ua, remoteAddr string) *http.Request {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("User-Agent", ua)
+	req.RemoteAddr = remoteAddr
+	return req
+}
+
+func TestSessionValid(t *testing.T) {
+	cases := []struct {
+		name     string
+		opts     SecurityOptions
+		stamp    *http.Request
+		check    *http.Request
+		lastSeen time.Duration // ago, zero means not set
+		loginAt  time.Duration // ago, zero means not set
+		want     bool
+	}{
+		{
+			name:  "no binding, no timeouts, always valid",
+			opts:  SecurityOptions{},
+			stamp: newRequest("chrome", "1.2.3.4:1111"),
+			check: newRequest("firefox", "9.9.9.9:2222"),
+			want:  true,
+		},
+		{
+			name:  "UA bound, matching UA passes",
+			opts:  SecurityOptions{BindUserAgent: true},
+			stamp: newRequest("chrome", "1.2.3.4:1111"),
+			check: newRequest("chrome", "9.9.9.9:2222"),
+			want:  true,
+		},
+		{
+			name:  "UA bound, mismatched UA fails",
+			opts:  SecurityOptions{BindUserAgent: true},
+			stamp: newRequest("chrome", "1.2.3.4:1111"),
+			check: newRequest("firefox", "1.2.3.4:1111"),
+			want:  false,
+		},
+		{
+			name:  "strict IP bound, same /32 passes",
+			opts:  SecurityOptions{BindIP: BindStrict},
+			stamp: newRequest("chrome", "1.2.3.4:1111"),
+			check: newRequest("chrome", "1.2.3.4:2222"),
+			want:  true,
+		},
+		{
+			name:  "strict IP bound, changed IP fails",
+			opts:  SecurityOptions{BindIP: BindStrict},
+			stamp: newRequest("chrome", "1.2.3.4:1111"),
+			check: newRequest("chrome", "1.2.3.5:1111"),
+			want:  false,
+		},
+		{
+			name:  "subnet IP bound, same /24 passes",
+			opts:  SecurityOptions{BindIP: BindSubnet},
+			stamp: newRequest("chrome", "1.2.3.4:1111"),
+			check: newRequest("chrome", "1.2.3.200:1111"),
+			want:  true,
+		},
+		{
+			name:  "subnet IP bound, different /24 fails",
+			opts:  SecurityOptions{BindIP: BindSubnet},
+			stamp: newRequest("chrome", "1.2.3.4:1111"),
+			check: newRequest("chrome", "1.2.4.4:1111"),
+			want:  false,
+		},
+		{
+			name:     "idle timeout exceeded fails",
+			opts:     SecurityOptions{IdleTimeout: time.Minute},
+			stamp:    newRequest("chrome", "1.2.3.4:1111"),
+			check:    newRequest("chrome", "1.2.3.4:1111"),
+			lastSeen: 2 * time.Minute,
+			want:     false,
+		},
+		{
+			name:     "idle timeout not yet exceeded passes",
+			opts:     SecurityOptions{IdleTimeout: time.Minute},
+			stamp:    newRequest("chrome", "1.2.3.4:1111"),
+			check:    newRequest("chrome", "1.2.3.4:1111"),
+			lastSeen: 10 * time.Second,
+			want:     true,
+		},
+		{
+			name:    "absolute timeout exceeded fails even with recent activity",
+			opts:    SecurityOptions{AbsoluteTimeout: time.Hour},
+			stamp:   newRequest("chrome", "1.2.3.4:1111"),
+			check:   newRequest("chrome", "1.2.3.4:1111"),
+			loginAt: 2 * time.Hour,
+			want:    false,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			old := Security
+			Security = c.opts
+			defer func() { Security = old }()
+
+			s := newFakeStore()
+			nonce, err := randomNonce()
+			if err != nil {
+				t.Fatalf("randomNonce: %v", err)
+			}
+			s.Set(AUTH_NONCE, nonce)
+			s.Set(AUTH_FINGERPRINT, fingerprint(c.stamp, nonce, c.opts))
+
+			now := time.Now()
+			if c.lastSeen != 0 {
+				s.Set(AUTH_LAST_SEEN, now.Add(-c.lastSeen))
+			} else {
+				s.Set(AUTH_LAST_SEEN, now)
+			}
+			if c.loginAt != 0 {
+				s.Set(AUTH_LOGIN_AT, now.Add(-c.loginAt))
+			} else {
+				s.Set(AUTH_LOGIN_AT, now)
+			}
+
+			if got := sessionValid(s, c.check); got != c.want {
+				t.Errorf("sessionValid() = %v, want %v", got, c.want)
+			}
+		})
+	}
+}
@@ -5,11 +5,13 @@ package sessionauth
 
 import (
 	"fmt"
-	"github.com/go-martini/martini"
-	"github.com/martini-contrib/render"
-	"github.com/codinl/session"
 	"net/http"
+	"time"
+
 	"github.com/codinl/go-logger"
+	"github.com/codinl/session"
+	"github.com/go-martini/martini"
+	"github.com/martini-contrib/render"
 )
 
 // These are the default configuration values for this package. They
@@ -46,7 +48,11 @@ type Account interface {
 	// Return the unique identifier of this account object
 	UniqueId() interface{}
 
-	// Populate this account object with values
+	// Populate this account object with values. SessionAccount passes id
+	// through unchanged from the session, but TokenAuth/LoginRequiredAny
+	// pass a JWT's "sub" claim, which is always a string (see IssueToken).
+	// If UniqueId() returns a non-string type, GetById must be able to
+	// resolve an account from that string form too.
 	GetById(id interface{}) (Account, error)
 }
 
@@ -57,11 +63,11 @@ type Account interface {
 // The newUser() function should provide a valid 0value structure for the caller's
 // account type.
 func SessionAccount(newAccount func() Account) martini.Handler {
-	return func(s session.Store, c martini.Context) {
+	return func(s session.Store, c martini.Context, req *http.Request, w http.ResponseWriter) {
 		userId := s.Get(AUTH_UNIQUE_ID)
 		account := newAccount()
 
-		if userId != nil {
+		if userId != nil && sessionValid(s, req) {
 			var err error
 			account, err = account.GetById(userId)
 			logger.Debug("account=", account)
@@ -69,26 +75,83 @@ func SessionAccount(newAccount func() Account) martini.Handler {
 				logger.Error(err)
 			} else {
 				account.Login()
+				s.Set(AUTH_LAST_SEEN, time.Now())
 			}
+		} else if userId != nil {
+			// The fingerprint didn't match or the session timed out; treat
+			// it as anonymous rather than trusting the stale AUTH_UNIQUE_ID.
+			clearAuthKeys(s)
+		} else if RememberTokens != nil {
+			account = resolveRemembered(s, w, req, newAccount())
 		}
 
 		c.MapTo(account, (*Account)(nil))
 	}
 }
 
+// resolveRemembered looks for a remember-me cookie on req and, if one
+// resolves to a live RememberToken, reauthenticates the account it names
+// and returns it. It returns anonymous unchanged on any failure - an
+// absent cookie is the common case, not an error worth logging.
+func resolveRemembered(s session.Store, w http.ResponseWriter, req *http.Request, anonymous Account) Account {
+	accountId, err := resolveRememberCookie(w, req, RememberTTL)
+	if err != nil {
+		return anonymous
+	}
+
+	account, err := anonymous.GetById(accountId)
+	if err != nil {
+		logger.Error(err)
+		return anonymous
+	}
+
+	account.Login()
+	if err := AuthenticateSession(s, account, req); err != nil {
+		logger.Error(err)
+	}
+
+	return account
+}
+
 // AuthenticateSession will mark the session and account object as authenticated. Then
 // the Login() account function will be called. This function should be called after
 // you have validated a account.
-func AuthenticateSession(s session.Store, account Account) error {
+//
+// The session ID is rotated (if the session.Store supports it) to defeat
+// fixation, and the session is stamped with a fingerprint derived from req
+// and the configured Security options so that SessionAccount can detect
+// hijacking attempts later.
+func AuthenticateSession(s session.Store, account Account, req *http.Request) error {
 	logger.Debug("AuthenticateSession account=", account)
 	account.Login()
+
+	if rotator, ok := s.(SessionRotator); ok {
+		if err := rotator.Regenerate(); err != nil {
+			return err
+		}
+	}
+
+	nonce, err := randomNonce()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	s.Set(AUTH_NONCE, nonce)
+	s.Set(AUTH_FINGERPRINT, fingerprint(req, nonce, Security))
+	s.Set(AUTH_LOGIN_AT, now)
+	s.Set(AUTH_LAST_SEEN, now)
+
 	return Update(s, account)
 }
 
 // Logout will clear out the session and call the Logout() account function.
-func Logout(s session.Store, account Account) {
+// If a remember-me cookie is present, its token is deleted too so a copy of
+// the cookie can't be replayed after this logout.
+func Logout(s session.Store, account Account, w http.ResponseWriter, req *http.Request) {
 	account.Logout()
-	s.Delete(AUTH_UNIQUE_ID)
+	clearAuthKeys(s)
+	deleteRememberCookie(w, req)
 }
 
 // LoginRequired verifies that the current account is authenticated. Any routes that
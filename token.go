@@ -0,0 +1,248 @@
+package sessionauth
+
+import (
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/codinl/go-logger"
+	"github.com/codinl/session"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/go-martini/martini"
+	"github.com/martini-contrib/render"
+)
+
+// Claims is the set of JWT claims this package reads and writes. Roles
+// rides alongside the standard claims; IssueToken fills it from
+// RoleAccount.Roles and the verifiers parse it, but TokenAuth and
+// LoginRequiredAny do not apply it to the Account they map, which is
+// resolved through GetById.
+type Claims struct {
+	jwt.StandardClaims
+	Roles []string `json:"roles,omitempty"`
+}
+
+// TokenVerifier verifies a bearer token string and returns the claims it
+// carries. Callers can implement their own, or use HS256Verifier /
+// RS256Verifier for the common HMAC and RSA cases.
+type TokenVerifier interface {
+	Verify(tokenString string) (*Claims, error)
+}
+
+// requireExpiry rejects claims with no "exp" claim. jwt-go's own validation
+// only checks exp when it's present, so a token minted without one would
+// otherwise be accepted forever.
+func requireExpiry(claims *Claims) error {
+	if claims.ExpiresAt == 0 {
+		return errors.New("sessionauth: token has no expiry")
+	}
+	return nil
+}
+
+// TokenSigner signs a set of Claims into a bearer token string. IssueToken
+// uses whatever is assigned to Tokens.
+type TokenSigner interface {
+	Sign(claims Claims) (string, error)
+}
+
+// Tokens is the TokenSigner that IssueToken uses. It must be set, probably
+// during the initial setup of Martini, before IssueToken is called.
+var Tokens TokenSigner
+
+type hmacToken struct {
+	secret []byte
+}
+
+// HS256Verifier returns a TokenVerifier for JWTs signed with HMAC-SHA256
+// using secret.
+func HS256Verifier(secret []byte) TokenVerifier {
+	return &hmacToken{secret: secret}
+}
+
+// HS256Signer returns a TokenSigner for JWTs signed with HMAC-SHA256 using
+// secret.
+func HS256Signer(secret []byte) TokenSigner {
+	return &hmacToken{secret: secret}
+}
+
+func (h *hmacToken) Verify(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (interface{}, error) {
+		if t.Method.Alg() != jwt.SigningMethodHS256.Alg() {
+			return nil, fmt.Errorf("sessionauth: unexpected signing method %v", t.Header["alg"])
+		}
+		return h.secret, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid {
+		return nil, errors.New("sessionauth: invalid token")
+	}
+	if err := requireExpiry(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func (h *hmacToken) Sign(claims Claims) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(h.secret)
+}
+
+type rsaToken struct {
+	publicKey  *rsa.PublicKey
+	privateKey *rsa.PrivateKey
+}
+
+// RS256Verifier returns a TokenVerifier for JWTs signed with RSA-SHA256
+// using publicKey.
+func RS256Verifier(publicKey *rsa.PublicKey) TokenVerifier {
+	return &rsaToken{publicKey: publicKey}
+}
+
+// RS256Signer returns a TokenSigner for JWTs signed with RSA-SHA256 using
+// privateKey.
+func RS256Signer(privateKey *rsa.PrivateKey) TokenSigner {
+	return &rsaToken{privateKey: privateKey}
+}
+
+func (r *rsaToken) Verify(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (interface{}, error) {
+		if t.Method.Alg() != jwt.SigningMethodRS256.Alg() {
+			return nil, fmt.Errorf("sessionauth: unexpected signing method %v", t.Header["alg"])
+		}
+		return r.publicKey, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid {
+		return nil, errors.New("sessionauth: invalid token")
+	}
+	if err := requireExpiry(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func (r *rsaToken) Sign(claims Claims) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	return token.SignedString(r.privateKey)
+}
+
+// IssueToken signs a bearer token for account, good for ttl, using
+// whatever TokenSigner is assigned to Tokens. The token's "sub" claim is
+// the string form of account.UniqueId() (fmt.Sprintf("%v", ...), since JWT
+// claims are strings even when the underlying id type isn't); its "roles"
+// claim is populated from RoleAccount.Roles when account implements it.
+// Account.GetById must be able to resolve an account from that same
+// string, even when UniqueId() itself returns a non-string type.
+func IssueToken(account Account, ttl time.Duration) (string, error) {
+	if Tokens == nil {
+		return "", errors.New("sessionauth: TokenSigner is not configured")
+	}
+
+	var roles []string
+	if roleAccount, ok := account.(RoleAccount); ok {
+		roles = roleAccount.Roles()
+	}
+
+	now := time.Now()
+	claims := Claims{
+		StandardClaims: jwt.StandardClaims{
+			Subject:   fmt.Sprintf("%v", account.UniqueId()),
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(ttl).Unix(),
+		},
+		Roles: roles,
+	}
+
+	return Tokens.Sign(claims)
+}
+
+// bearerToken extracts the token string from an "Authorization: Bearer
+// ..." header, or "" if the header is absent or a different scheme.
+func bearerToken(req *http.Request) string {
+	header := req.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return ""
+	}
+	return strings.TrimPrefix(header, "Bearer ")
+}
+
+// TokenAuth inspects the Authorization header for a bearer token, verifies
+// it with verifier, and on success maps a fully-populated Account into the
+// Martini context exactly like SessionAccount does, bypassing the
+// session.Store entirely. A missing or invalid token maps the anonymous
+// account, the same way SessionAccount does for a visitor with no session.
+func TokenAuth(newAccount func() Account, verifier TokenVerifier) martini.Handler {
+	return func(req *http.Request, c martini.Context) {
+		account := newAccount()
+
+		if tokenString := bearerToken(req); tokenString != "" {
+			claims, err := verifier.Verify(tokenString)
+			if err != nil {
+				logger.Error(err)
+			} else if resolved, err := account.GetById(claims.Subject); err != nil {
+				logger.Error(err)
+			} else {
+				account = resolved
+				account.Login()
+			}
+		}
+
+		c.MapTo(account, (*Account)(nil))
+	}
+}
+
+// LoginRequiredAny accepts either a valid sessionauth session or a valid
+// bearer token, so the same route can serve both a web UI and a JSON API
+// without chaining SessionAccount/TokenAuth and LoginRequired separately.
+// Either path maps a fully-populated Account into the Martini context, the
+// same way SessionAccount/TokenAuth do. A request with no session and no
+// Authorization header is redirected to RedirectUrl like LoginRequired;
+// one with an Authorization header that fails verification gets a 401
+// instead, since redirecting an API client makes no sense.
+func LoginRequiredAny(newAccount func() Account, verifier TokenVerifier) martini.Handler {
+	return func(s session.Store, req *http.Request, r render.Render, c martini.Context) {
+		userId := s.Get(AUTH_UNIQUE_ID)
+		if userId != nil && sessionValid(s, req) {
+			if account, err := newAccount().GetById(userId); err != nil {
+				logger.Error(err)
+			} else {
+				account.Login()
+				c.MapTo(account, (*Account)(nil))
+				return
+			}
+		}
+
+		tokenString := bearerToken(req)
+		if tokenString == "" {
+			path := fmt.Sprintf("%s?%s=%s", RedirectUrl, RedirectParam, req.URL.Path)
+			r.Redirect(path, 302)
+			return
+		}
+
+		claims, err := verifier.Verify(tokenString)
+		if err != nil {
+			logger.Error(err)
+			r.Text(401, "Unauthorized")
+			return
+		}
+
+		account, err := newAccount().GetById(claims.Subject)
+		if err != nil {
+			logger.Error(err)
+			r.Text(401, "Unauthorized")
+			return
+		}
+
+		account.Login()
+		c.MapTo(account, (*Account)(nil))
+	}
+}
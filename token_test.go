@@ -0,0 +1,77 @@
+package sessionauth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+func TestHS256VerifierRejectsOtherAlgorithms(t *testing.T) {
+	secret := []byte("hmac-secret")
+	verifier := HS256Verifier(secret)
+
+	claims := Claims{
+		StandardClaims: jwt.StandardClaims{
+			Subject:   "user-1",
+			ExpiresAt: time.Now().Add(time.Hour).Unix(),
+		},
+	}
+
+	t.Run("rejects RS256", func(t *testing.T) {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatalf("rsa.GenerateKey: %v", err)
+		}
+
+		tokenString, err := jwt.NewWithClaims(jwt.SigningMethodRS256, claims).SignedString(key)
+		if err != nil {
+			t.Fatalf("SignedString: %v", err)
+		}
+
+		if _, err := verifier.Verify(tokenString); err == nil {
+			t.Fatal("expected HS256Verifier to reject an RS256 token")
+		}
+	})
+
+	t.Run("rejects alg=none", func(t *testing.T) {
+		tokenString, err := jwt.NewWithClaims(jwt.SigningMethodNone, claims).SignedString(jwt.UnsafeAllowNoneSignatureType)
+		if err != nil {
+			t.Fatalf("SignedString: %v", err)
+		}
+
+		if _, err := verifier.Verify(tokenString); err == nil {
+			t.Fatal("expected HS256Verifier to reject an alg=none token")
+		}
+	})
+
+	t.Run("rejects a token with no exp claim", func(t *testing.T) {
+		noExpiry := Claims{StandardClaims: jwt.StandardClaims{Subject: "user-1"}}
+		tokenString, err := HS256Signer(secret).Sign(noExpiry)
+		if err != nil {
+			t.Fatalf("Sign: %v", err)
+		}
+
+		if _, err := verifier.Verify(tokenString); err == nil {
+			t.Fatal("expected HS256Verifier to reject a token with no exp claim")
+		}
+	})
+
+	t.Run("accepts a matching HS256 token", func(t *testing.T) {
+		signer := HS256Signer(secret)
+		tokenString, err := signer.Sign(claims)
+		if err != nil {
+			t.Fatalf("Sign: %v", err)
+		}
+
+		got, err := verifier.Verify(tokenString)
+		if err != nil {
+			t.Fatalf("Verify: %v", err)
+		}
+		if got.Subject != claims.Subject {
+			t.Errorf("Subject = %q, want %q", got.Subject, claims.Subject)
+		}
+	})
+}